@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"sync"
+
+	utilruntime "k8s.io/kubernetes/pkg/util/runtime"
+	"k8s.io/kubernetes/pkg/watch"
+
+	projectapi "github.com/openshift/origin/pkg/project/api"
+	projectcache "github.com/openshift/origin/pkg/project/cache"
+	projectutil "github.com/openshift/origin/pkg/project/util"
+)
+
+// broadcasterWatcher is the watch.Interface handed back to callers of NewSharedUserProjectWatcher.
+// It attaches to a userWatchHub instead of registering its own CacheWatcher with the auth cache,
+// so N simultaneous watches for the same (username, groups) only pay the auth cache membership
+// cost once.
+type broadcasterWatcher struct {
+	// hub is nil until Watch() acquires it from defaultHubRegistry; deliver() and disconnect()
+	// are only ever reachable after that, since nothing can notify this watcher before it has
+	// subscribed.
+	hub *userWatchHub
+
+	username     string
+	groups       []string
+	projectCache *projectcache.ProjectCache
+	authCache    WatchableCache
+	filter       func(*projectapi.Project) bool
+
+	queue *watcherQueue
+
+	outgoing chan watch.Event
+	userStop chan struct{}
+	stopLock sync.Mutex
+
+	// knownProjectsLock guards knownProjects. deliver() is only ever called serially by the hub's
+	// own dispatcher, but Watch() also seeds knownProjects from the registry's initial snapshot
+	// after the watcher is already registered with the hub, so that seeding can race a concurrent
+	// deliver() call for the same watcher.
+	knownProjectsLock sync.Mutex
+	// knownProjects tracks this subscriber's own view of what it has been told about, which can
+	// be a strict subset of the hub's canonical knownProjects once filter is applied.
+	knownProjects map[string]string
+
+	emit func(watch.Event)
+}
+
+// newBroadcasterWatcher creates a broadcasterWatcher. It does not acquire its hub from
+// defaultHubRegistry until Watch() is called, mirroring how userProjectWatcher defers everything
+// but its initial snapshot to Watch().
+func newBroadcasterWatcher(username string, groups []string, projectCache *projectcache.ProjectCache, authCache WatchableCache, filter func(*projectapi.Project) bool, queueSize int, fullChannelBehavior FullChannelBehavior) *broadcasterWatcher {
+	w := &broadcasterWatcher{
+		username:     username,
+		groups:       groups,
+		projectCache: projectCache,
+		authCache:    authCache,
+		filter:       filter,
+
+		queue: newWatcherQueue(queueSize, fullChannelBehavior),
+
+		outgoing: make(chan watch.Event),
+		userStop: make(chan struct{}),
+
+		knownProjects: map[string]string{},
+	}
+	w.emit = func(e watch.Event) {
+		select {
+		case w.outgoing <- e:
+		case <-w.userStop:
+		}
+	}
+	return w
+}
+
+// deliver is called by userWatchHub.broadcast for every event the hub produces. It applies this
+// watcher's filter and maintains its own knownProjects so that filter-transition Deletes (see
+// userProjectWatcher's selector support) stay correct independent of the hub's canonical view.
+func (w *broadcasterWatcher) deliver(namespaceName string, event watch.Event) {
+	// userWatchHub always builds its events from projectutil.ConvertNamespace, so this is safe.
+	project := event.Object.(*projectapi.Project)
+
+	w.knownProjectsLock.Lock()
+	_, known := w.knownProjects[namespaceName]
+	matches := w.filter == nil || w.filter(project)
+
+	switch {
+	case event.Type == watch.Deleted:
+		if !known {
+			w.knownProjectsLock.Unlock()
+			return
+		}
+		delete(w.knownProjects, namespaceName)
+		w.knownProjectsLock.Unlock()
+		w.queue.notify(namespaceName, event, w.disconnect)
+
+	case !matches:
+		if !known {
+			w.knownProjectsLock.Unlock()
+			return
+		}
+		delete(w.knownProjects, namespaceName)
+		w.knownProjectsLock.Unlock()
+		w.queue.notify(namespaceName, watch.Event{Type: watch.Deleted, Object: project}, w.disconnect)
+
+	default:
+		w.knownProjects[namespaceName] = project.ResourceVersion
+		w.knownProjectsLock.Unlock()
+		outgoing := event
+		if known {
+			outgoing.Type = watch.Modified
+		}
+		w.queue.notify(namespaceName, outgoing, w.disconnect)
+	}
+}
+
+func (w *broadcasterWatcher) disconnect() {
+	defaultHubRegistry.release(w.hub, w)
+	w.Stop()
+}
+
+// Watch acquires the watcher's hub and starts delivering events. Meant to be called as a
+// goroutine.
+func (w *broadcasterWatcher) Watch() {
+	defer close(w.outgoing)
+	defer utilruntime.HandleCrash()
+
+	hub, initialProjects := defaultHubRegistry.acquire(w.username, w.groups, w.projectCache, w.authCache, w)
+	w.hub = hub
+	defer defaultHubRegistry.release(w.hub, w)
+
+	for name, resourceVersion := range initialProjects {
+		project, err := w.projectForNamespace(name)
+		if err != nil {
+			continue
+		}
+		if w.filter != nil && !w.filter(project) {
+			continue
+		}
+		w.knownProjectsLock.Lock()
+		w.knownProjects[name] = resourceVersion
+		w.knownProjectsLock.Unlock()
+		w.emit(watch.Event{Type: watch.Added, Object: project})
+	}
+
+	for {
+		select {
+		case <-w.userStop:
+			return
+
+		case <-w.queue.readyChan():
+			for {
+				event, _, ok := w.queue.dequeue()
+				if !ok {
+					break
+				}
+				w.emit(event)
+			}
+		}
+	}
+}
+
+// projectForNamespace resolves the current project for a name via the shared project cache,
+// used only while building each subscriber's own initial snapshot.
+func (w *broadcasterWatcher) projectForNamespace(name string) (*projectapi.Project, error) {
+	namespace, err := w.projectCache.GetNamespace(name)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return nil, err
+	}
+	return projectutil.ConvertNamespace(namespace), nil
+}
+
+// ResultChan implements watch.Interface.
+func (w *broadcasterWatcher) ResultChan() <-chan watch.Event {
+	return w.outgoing
+}
+
+// Stop implements watch.Interface.
+func (w *broadcasterWatcher) Stop() {
+	w.stopLock.Lock()
+	defer w.stopLock.Unlock()
+
+	select {
+	case <-w.userStop:
+		return
+	default:
+	}
+	close(w.userStop)
+}
+
+// NewSharedUserProjectWatcher is like NewUserProjectWatcher, but fans the watch out through a
+// per-(username, groups) userWatchHub instead of registering its own CacheWatcher with authCache.
+// Prefer this constructor for REST-serving code paths, where the same user commonly has several
+// concurrent `oc get projects -w` connections open (multiple terminals, multiple browser tabs).
+// The underlying hub isn't acquired from the registry until the returned watcher's Watch() runs.
+func NewSharedUserProjectWatcher(username string, groups []string, projectCache *projectcache.ProjectCache, authCache WatchableCache, filter func(*projectapi.Project) bool, queueSize int, fullChannelBehavior FullChannelBehavior) watch.Interface {
+	return newBroadcasterWatcher(username, groups, projectCache, authCache, filter, queueSize, fullChannelBehavior)
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/auth/user"
+	utilruntime "k8s.io/kubernetes/pkg/util/runtime"
+	"k8s.io/kubernetes/pkg/util/sets"
+	"k8s.io/kubernetes/pkg/watch"
+
+	projectcache "github.com/openshift/origin/pkg/project/cache"
+	projectutil "github.com/openshift/origin/pkg/project/util"
+)
+
+// userWatchHubKey identifies the set of subscribers that can share one upstream CacheWatcher
+// registration: for a fixed username and group set, GroupMembershipChanged always produces the
+// same canonical project list, so there is never a reason to register with the auth cache twice.
+type userWatchHubKey struct {
+	username string
+	groups   string
+}
+
+func newUserWatchHubKey(username string, groups []string) userWatchHubKey {
+	sorted := append([]string(nil), groups...)
+	sort.Strings(sorted)
+	return userWatchHubKey{username: username, groups: strings.Join(sorted, ",")}
+}
+
+// hubRegistry locates or lazily creates the shared userWatchHub for a (username, groups) pair.
+type hubRegistry struct {
+	lock sync.Mutex
+	hubs map[userWatchHubKey]*userWatchHub
+}
+
+// defaultHubRegistry backs NewSharedUserProjectWatcher. It is process-global because the hubs it
+// tracks are keyed by (username, groups), not by any particular REST request.
+var defaultHubRegistry = &hubRegistry{hubs: map[userWatchHubKey]*userWatchHub{}}
+
+// acquire finds or creates the hub for (username, groups) and subscribes watcher to it, all
+// while holding r.lock so that a concurrent release can never evict the hub out from under a
+// watcher that is in the process of joining it. It returns the hub along with a snapshot of its
+// currently known projects for watcher to seed its own initial state from.
+func (r *hubRegistry) acquire(username string, groups []string, projectCache *projectcache.ProjectCache, authCache WatchableCache, watcher *broadcasterWatcher) (*userWatchHub, map[string]string) {
+	key := newUserWatchHubKey(username, groups)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	hub, ok := r.hubs[key]
+	if !ok {
+		hub = newUserWatchHub(key, username, groups, projectCache, authCache)
+		r.hubs[key] = hub
+	}
+	return hub, hub.addSubscriber(watcher)
+}
+
+// release unsubscribes watcher from hub, tearing down the hub's upstream registration and
+// evicting it from the registry if watcher was its last subscriber. Holding r.lock for the whole
+// operation keeps it atomic with a concurrent acquire: either acquire observes the hub before
+// release evicts it (and re-subscribes the watcher it's starting), or it doesn't observe the hub
+// at all and creates a fresh one.
+func (r *hubRegistry) release(hub *userWatchHub, watcher *broadcasterWatcher) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !hub.removeSubscriber(watcher) {
+		return
+	}
+	hub.authCache.RemoveWatcher(hub)
+	if existing, ok := r.hubs[hub.key]; ok && existing == hub {
+		delete(r.hubs, hub.key)
+	}
+}
+
+// userWatchHub registers a single CacheWatcher with the auth cache on behalf of every
+// broadcasterWatcher subscribed for the same (username, groups) pair, and fans the resulting
+// notifications out to each of them. This turns N simultaneous `oc get projects -w` connections
+// from the same user into one upstream registration instead of N, mirroring
+// k8s.io/apimachinery/pkg/watch/mux.go's Broadcaster.
+type userWatchHub struct {
+	key      userWatchHubKey
+	username string
+	groups   []string
+
+	projectCache *projectcache.ProjectCache
+	authCache    WatchableCache
+
+	lock sync.Mutex
+	// knownProjects is the hub's canonical view of the last ResourceVersion it has seen per
+	// namespace, independent of any one subscriber's filter.
+	knownProjects map[string]string
+	subscribers   map[*broadcasterWatcher]struct{}
+}
+
+func newUserWatchHub(key userWatchHubKey, username string, groups []string, projectCache *projectcache.ProjectCache, authCache WatchableCache) *userWatchHub {
+	userInfo := &user.DefaultInfo{Name: username, Groups: groups}
+	namespaces, _ := authCache.List(userInfo)
+	knownProjects := map[string]string{}
+	for _, namespace := range namespaces.Items {
+		knownProjects[namespace.Name] = namespace.ResourceVersion
+	}
+
+	return &userWatchHub{
+		key:           key,
+		username:      username,
+		groups:        groups,
+		projectCache:  projectCache,
+		authCache:     authCache,
+		knownProjects: knownProjects,
+		subscribers:   map[*broadcasterWatcher]struct{}{},
+	}
+}
+
+// GroupMembershipChanged implements CacheWatcher. It is registered with the auth cache at most
+// once per hub, no matter how many broadcasterWatchers end up subscribed.
+func (h *userWatchHub) GroupMembershipChanged(namespaceName string, latestUsers, latestGroups, removedUsers, removedGroups, addedUsers, addedGroups sets.String) {
+	hasAccess := latestUsers.Has(h.username) || latestGroups.HasAny(h.groups...)
+	removed := !hasAccess && (removedUsers.Has(h.username) || removedGroups.HasAny(h.groups...))
+
+	switch {
+	case removed:
+		h.lock.Lock()
+		if _, known := h.knownProjects[namespaceName]; !known {
+			h.lock.Unlock()
+			return
+		}
+		delete(h.knownProjects, namespaceName)
+		h.lock.Unlock()
+
+		h.broadcast(namespaceName, watch.Event{
+			Type:   watch.Deleted,
+			Object: projectutil.ConvertNamespace(&kapi.Namespace{ObjectMeta: kapi.ObjectMeta{Name: namespaceName}}),
+		})
+
+	case hasAccess:
+		namespace, err := h.projectCache.GetNamespace(namespaceName)
+		if err != nil {
+			utilruntime.HandleError(err)
+			return
+		}
+
+		h.lock.Lock()
+		lastKnownResourceVersion, known := h.knownProjects[namespaceName]
+		if known && lastKnownResourceVersion == namespace.ResourceVersion {
+			h.lock.Unlock()
+			return
+		}
+		h.knownProjects[namespace.Name] = namespace.ResourceVersion
+		h.lock.Unlock()
+
+		event := watch.Event{
+			Type:   watch.Added,
+			Object: projectutil.ConvertNamespace(namespace),
+		}
+		if known {
+			event.Type = watch.Modified
+		}
+		h.broadcast(namespaceName, event)
+	}
+}
+
+// broadcast fans event out to every currently-subscribed watcher. Each subscriber applies its
+// own filter and tracks its own knownProjects, the same way a standalone userProjectWatcher does.
+func (h *userWatchHub) broadcast(namespaceName string, event watch.Event) {
+	h.lock.Lock()
+	subscribers := make([]*broadcasterWatcher, 0, len(h.subscribers))
+	for subscriber := range h.subscribers {
+		subscribers = append(subscribers, subscriber)
+	}
+	h.lock.Unlock()
+
+	for _, subscriber := range subscribers {
+		subscriber.deliver(namespaceName, event)
+	}
+}
+
+// addSubscriber attaches watcher to the hub, registering the hub with the auth cache the first
+// time a subscriber joins, and returns a snapshot of the hub's currently known projects for the
+// subscriber to seed its own initial state from instead of paying for its own authCache.List.
+// Callers must hold defaultHubRegistry.lock so that joining is atomic with a concurrent release.
+func (h *userWatchHub) addSubscriber(watcher *broadcasterWatcher) map[string]string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.subscribers) == 0 {
+		userInfo := &user.DefaultInfo{Name: h.username, Groups: h.groups}
+		h.authCache.AddWatcher(userInfo, h)
+	}
+	h.subscribers[watcher] = struct{}{}
+
+	snapshot := make(map[string]string, len(h.knownProjects))
+	for name, resourceVersion := range h.knownProjects {
+		snapshot[name] = resourceVersion
+	}
+	return snapshot
+}
+
+// removeSubscriber detaches watcher, reporting whether it was both still subscribed and the
+// hub's last subscriber. Callers must hold defaultHubRegistry.lock so that the last-subscriber
+// check is atomic with a concurrent acquire; the caller is responsible for tearing down the
+// upstream registration and evicting the hub from the registry once this returns true.
+//
+// A watcher can call release more than once concurrently (e.g. a WaitIfChannelFull overflow on
+// one namespace times out around the same time as one on another), so this only reports true for
+// whichever call actually finds watcher still present, making teardown happen exactly once.
+func (h *userWatchHub) removeSubscriber(watcher *broadcasterWatcher) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if _, present := h.subscribers[watcher]; !present {
+		return false
+	}
+	delete(h.subscribers, watcher)
+	return len(h.subscribers) == 0
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"sync"
+	"testing"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/auth/user"
+)
+
+// fakeWatchableCache is a minimal WatchableCache for exercising userWatchHub/hubRegistry without
+// a real project cache.
+type fakeWatchableCache struct {
+	lock            sync.Mutex
+	addedWatchers   int
+	removedWatchers int
+}
+
+func (f *fakeWatchableCache) RemoveWatcher(CacheWatcher) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.removedWatchers++
+}
+
+func (f *fakeWatchableCache) AddWatcher(user.Info, CacheWatcher) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.addedWatchers++
+}
+
+func (f *fakeWatchableCache) List(user.Info) (*kapi.NamespaceList, error) {
+	return &kapi.NamespaceList{}, nil
+}
+
+func TestUserWatchHubRemoveSubscriberIsIdempotent(t *testing.T) {
+	cache := &fakeWatchableCache{}
+	hub := newUserWatchHub(newUserWatchHubKey("user1", nil), "user1", nil, nil, cache)
+	watcher := &broadcasterWatcher{}
+
+	hub.addSubscriber(watcher)
+
+	if last := hub.removeSubscriber(watcher); !last {
+		t.Fatal("expected the first removeSubscriber call to report it was the last subscriber")
+	}
+	if last := hub.removeSubscriber(watcher); last {
+		t.Fatal("expected a second removeSubscriber call for the same watcher to report false, not re-trigger teardown")
+	}
+}
+
+func TestHubRegistryReleaseIsIdempotentUnderConcurrentCallers(t *testing.T) {
+	cache := &fakeWatchableCache{}
+	registry := &hubRegistry{hubs: map[userWatchHubKey]*userWatchHub{}}
+	watcher := &broadcasterWatcher{}
+
+	hub, _ := registry.acquire("user1", nil, nil, cache, watcher)
+
+	// Simulates several WaitIfChannelFull overflow goroutines for the same watcher all timing
+	// out around the same time and each calling disconnect -> release.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			registry.release(hub, watcher)
+		}()
+	}
+	wg.Wait()
+
+	if cache.removedWatchers != 1 {
+		t.Errorf("expected exactly one RemoveWatcher call despite %d concurrent release calls, got %d", 5, cache.removedWatchers)
+	}
+	if _, stillRegistered := registry.hubs[hub.key]; stillRegistered {
+		t.Error("expected the hub to have been evicted from the registry")
+	}
+}
+
+func TestHubRegistryAcquireReusesExistingHub(t *testing.T) {
+	cache := &fakeWatchableCache{}
+	registry := &hubRegistry{hubs: map[userWatchHubKey]*userWatchHub{}}
+
+	hub1, _ := registry.acquire("user1", []string{"group1"}, nil, cache, &broadcasterWatcher{})
+	hub2, _ := registry.acquire("user1", []string{"group1"}, nil, cache, &broadcasterWatcher{})
+
+	if hub1 != hub2 {
+		t.Error("expected a second acquire for the same (username, groups) to reuse the existing hub")
+	}
+	if cache.addedWatchers != 1 {
+		t.Errorf("expected AddWatcher to be called exactly once across both subscribers, got %d", cache.addedWatchers)
+	}
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+// FullChannelBehavior controls what a watcherQueue does once it fills up, modeled on
+// k8s.io/apimachinery/pkg/watch.Broadcaster's FullChannelBehavior.
+type FullChannelBehavior int
+
+const (
+	// DisconnectIfChannelFull immediately removes the watcher and breaks the connection, the
+	// long-standing default.
+	DisconnectIfChannelFull FullChannelBehavior = iota
+	// DropIfChannelFull coalesces notifications for the same namespace into the newest one
+	// instead of appending, and drops the incoming notification outright if the queue is full
+	// and holds nothing to coalesce with. This keeps long-running watches alive through bursty
+	// auth cache churn at the cost of strict delivery ordering.
+	DropIfChannelFull
+	// WaitIfChannelFull blocks the auth cache's dispatcher for up to a bounded timeout waiting
+	// for room in the queue before falling back to DisconnectIfChannelFull.
+	WaitIfChannelFull
+)
+
+// defaultWatcherQueueSize matches the historical fixed depth of cacheIncoming.
+const defaultWatcherQueueSize = 1000
+
+// defaultWatcherWaitTimeout bounds how long WaitIfChannelFull will block the auth cache
+// dispatcher before giving up and disconnecting the watcher.
+const defaultWatcherWaitTimeout = 5 * time.Second
+
+// pendingNotification is a single queued, not-yet-delivered watch.Event for one namespace.
+type pendingNotification struct {
+	namespace string
+	event     watch.Event
+}
+
+// watcherQueue is the bounded, coalescing notification queue shared by userProjectWatcher and
+// broadcasterWatcher. Events queued with notify() are delivered in order by a single consumer
+// goroutine repeatedly calling dequeue() after waking on readyChan().
+type watcherQueue struct {
+	lock sync.Mutex
+	// queue holds notifications not yet delivered, in delivery order. Its behavior once full
+	// is governed by fullChannelBehavior.
+	queue []pendingNotification
+	// queueMax is the maximum number of distinct pending notifications.
+	queueMax int
+	// ready is signaled (non-blocking) whenever queue becomes non-empty.
+	ready chan struct{}
+	// notFull is broadcast whenever an item leaves queue, so WaitIfChannelFull can wake up.
+	notFull *sync.Cond
+	// fullChannelBehavior chooses what happens to a notification that arrives once queue is full.
+	fullChannelBehavior FullChannelBehavior
+	// waitTimeout bounds how long WaitIfChannelFull blocks before falling back to disconnecting.
+	waitTimeout time.Duration
+	// waitTurns orders the goroutines notify spawns for WaitIfChannelFull so they still attempt
+	// to enqueue in the same order notify was called in, even though none of them run on the
+	// calling goroutine. The head of waitTurns is closed; each waiter closes the next entry once
+	// it's done, successfully or not.
+	waitTurns []chan struct{}
+}
+
+// newWatcherQueue creates a watcherQueue. A queueSize of 0 or less falls back to
+// defaultWatcherQueueSize.
+func newWatcherQueue(queueSize int, fullChannelBehavior FullChannelBehavior) *watcherQueue {
+	if queueSize <= 0 {
+		queueSize = defaultWatcherQueueSize
+	}
+	q := &watcherQueue{
+		queueMax:            queueSize,
+		ready:               make(chan struct{}, 1),
+		fullChannelBehavior: fullChannelBehavior,
+		waitTimeout:         defaultWatcherWaitTimeout,
+	}
+	q.notFull = sync.NewCond(&q.lock)
+	return q
+}
+
+// enqueueLocked inserts or coalesces a notification into queue. It must be called with lock
+// held, and reports whether the notification was accepted. Coalescing only applies under
+// DropIfChannelFull; the other behaviors preserve strict per-namespace delivery ordering.
+func (q *watcherQueue) enqueueLocked(namespaceName string, event watch.Event) bool {
+	if q.fullChannelBehavior == DropIfChannelFull {
+		for i := range q.queue {
+			if q.queue[i].namespace == namespaceName {
+				// Fold consecutive notifications for the same namespace into the latest state;
+				// there's no reason to deliver state the watcher will see superseded on the
+				// very next notification.
+				q.queue[i].event = event
+				return true
+			}
+		}
+	}
+	if len(q.queue) >= q.queueMax {
+		return false
+	}
+	q.queue = append(q.queue, pendingNotification{namespace: namespaceName, event: event})
+	return true
+}
+
+// notify queues event for namespaceName for delivery, applying fullChannelBehavior if the queue
+// is full and the event can't be coalesced into an existing entry. onDisconnect is invoked if the
+// notification ultimately can't be delivered and the caller should tear the watch down.
+//
+// notify never blocks: it is called from CacheWatcher.GroupMembershipChanged, which the auth
+// cache invokes serially for every watcher and which MUST NOT BLOCK. WaitIfChannelFull's wait
+// instead runs on a goroutine of its own; see waitAndEnqueue.
+func (q *watcherQueue) notify(namespaceName string, event watch.Event, onDisconnect func()) {
+	q.lock.Lock()
+
+	if q.enqueueLocked(namespaceName, event) {
+		q.lock.Unlock()
+		q.signalReady()
+		return
+	}
+
+	switch q.fullChannelBehavior {
+	case DropIfChannelFull:
+		// Nothing to coalesce with and no room left; drop the newest notification rather than
+		// grow without bound or tear down the watch.
+		q.lock.Unlock()
+		glog.V(4).Infof("project watch queue full, dropping notification for %s", namespaceName)
+
+	case WaitIfChannelFull:
+		// Reserve this notification's place in line before handing the wait off to its own
+		// goroutine, so concurrent overflow notifications still attempt to enqueue in the order
+		// notify was called in rather than racing each other for the spot that frees up.
+		turn := make(chan struct{})
+		if len(q.waitTurns) == 0 {
+			close(turn)
+		}
+		q.waitTurns = append(q.waitTurns, turn)
+		q.lock.Unlock()
+		go q.waitAndEnqueue(namespaceName, event, onDisconnect, turn)
+
+	default: // DisconnectIfChannelFull
+		q.lock.Unlock()
+		onDisconnect()
+	}
+}
+
+// waitAndEnqueue is notify's WaitIfChannelFull path, moved onto its own goroutine so notify
+// itself never blocks the caller. It waits its turn behind any earlier-queued waiter, then waits
+// for room in the queue for up to waitTimeout, falling back to onDisconnect if none opens up in
+// time either way.
+func (q *watcherQueue) waitAndEnqueue(namespaceName string, event watch.Event, onDisconnect func(), turn <-chan struct{}) {
+	<-turn
+
+	q.lock.Lock()
+	deadline := time.Now().Add(q.waitTimeout)
+	timer := time.AfterFunc(q.waitTimeout, func() {
+		q.lock.Lock()
+		q.notFull.Broadcast()
+		q.lock.Unlock()
+	})
+	accepted := false
+	for !accepted {
+		if !time.Now().Before(deadline) {
+			break
+		}
+		q.notFull.Wait()
+		accepted = q.enqueueLocked(namespaceName, event)
+	}
+	timer.Stop()
+
+	q.waitTurns = q.waitTurns[1:]
+	if len(q.waitTurns) > 0 {
+		close(q.waitTurns[0])
+	}
+	q.lock.Unlock()
+
+	if accepted {
+		q.signalReady()
+		return
+	}
+	onDisconnect()
+}
+
+// signalReady wakes the consumer up to drain queue, without blocking if it's already awake.
+func (q *watcherQueue) signalReady() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// readyChan is signaled whenever queue transitions from empty to non-empty.
+func (q *watcherQueue) readyChan() <-chan struct{} {
+	return q.ready
+}
+
+// dequeue pops the oldest pending notification, reporting the queue depth observed (including
+// the popped item) for HWM tracking.
+func (q *watcherQueue) dequeue() (event watch.Event, depth int, ok bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if len(q.queue) == 0 {
+		return watch.Event{}, 0, false
+	}
+	depth = len(q.queue)
+	event = q.queue[0].event
+	q.queue = q.queue[1:]
+	q.notFull.Broadcast()
+	return event, depth, true
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/watch"
+)
+
+func TestWatcherQueueDisconnectIfChannelFullDisconnectsWhenFull(t *testing.T) {
+	q := newWatcherQueue(1, DisconnectIfChannelFull)
+
+	q.notify("ns1", watch.Event{Type: watch.Added}, func() { t.Fatal("unexpected disconnect for first notification") })
+
+	disconnected := make(chan struct{})
+	q.notify("ns2", watch.Event{Type: watch.Added}, func() { close(disconnected) })
+
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("expected onDisconnect to be called once the queue was full")
+	}
+
+	if _, depth, ok := q.dequeue(); !ok || depth != 1 {
+		t.Fatalf("expected exactly the first notification to remain queued, got depth=%d ok=%v", depth, ok)
+	}
+}
+
+func TestWatcherQueueDisconnectIfChannelFullPreservesOrdering(t *testing.T) {
+	q := newWatcherQueue(10, DisconnectIfChannelFull)
+
+	q.notify("ns1", watch.Event{Type: watch.Added}, func() { t.Fatal("unexpected disconnect") })
+	q.notify("ns1", watch.Event{Type: watch.Modified}, func() { t.Fatal("unexpected disconnect") })
+	q.notify("ns2", watch.Event{Type: watch.Added}, func() { t.Fatal("unexpected disconnect") })
+
+	event, _, ok := q.dequeue()
+	if !ok || event.Type != watch.Added {
+		t.Fatalf("expected the first ns1 notification to survive undisturbed, got %+v ok=%v", event, ok)
+	}
+	event, _, ok = q.dequeue()
+	if !ok || event.Type != watch.Modified {
+		t.Fatalf("expected the second ns1 notification next, got %+v ok=%v", event, ok)
+	}
+	event, _, ok = q.dequeue()
+	if !ok || event.Type != watch.Added {
+		t.Fatalf("expected the ns2 notification last, got %+v ok=%v", event, ok)
+	}
+}
+
+func TestWatcherQueueDropIfChannelFullCoalescesSameNamespace(t *testing.T) {
+	q := newWatcherQueue(10, DropIfChannelFull)
+
+	q.notify("ns1", watch.Event{Type: watch.Added}, func() { t.Fatal("unexpected disconnect") })
+	q.notify("ns1", watch.Event{Type: watch.Modified}, func() { t.Fatal("unexpected disconnect") })
+
+	if len(q.queue) != 1 {
+		t.Fatalf("expected the two ns1 notifications to coalesce into one pending entry, got %d", len(q.queue))
+	}
+
+	event, depth, ok := q.dequeue()
+	if !ok || depth != 1 || event.Type != watch.Modified {
+		t.Fatalf("expected the coalesced entry to carry the latest event, got %+v depth=%d ok=%v", event, depth, ok)
+	}
+}
+
+func TestWatcherQueueDropIfChannelFullDropsWhenFullAndNothingToCoalesce(t *testing.T) {
+	q := newWatcherQueue(1, DropIfChannelFull)
+
+	q.notify("ns1", watch.Event{Type: watch.Added}, func() { t.Fatal("unexpected disconnect") })
+	q.notify("ns2", watch.Event{Type: watch.Added}, func() { t.Fatal("unexpected disconnect") })
+
+	if len(q.queue) != 1 {
+		t.Fatalf("expected the second, unrelated notification to be dropped, got %d pending", len(q.queue))
+	}
+	if q.queue[0].namespace != "ns1" {
+		t.Fatalf("expected the first notification to remain queued, got %q", q.queue[0].namespace)
+	}
+}
+
+func TestWatcherQueueWaitIfChannelFullEnqueuesOnceRoomOpens(t *testing.T) {
+	q := newWatcherQueue(1, WaitIfChannelFull)
+	// Short enough that the test doesn't hang if the race below is lost, but long enough that
+	// the dequeue below has every chance to win it first.
+	q.waitTimeout = 100 * time.Millisecond
+
+	q.notify("ns1", watch.Event{Type: watch.Added}, func() { t.Fatal("unexpected disconnect") })
+	q.notify("ns2", watch.Event{Type: watch.Added}, func() { t.Fatal("unexpected disconnect for ns2") })
+
+	// The queue is full, so the ns2 notification is now waiting on its own goroutine. Draining
+	// the first entry wakes it if it's already waiting; otherwise waitTimeout's own timer wakes
+	// it to recheck, and it finds the room freed here either way.
+	if _, _, ok := q.dequeue(); !ok {
+		t.Fatal("expected to dequeue the first notification")
+	}
+
+	select {
+	case <-q.readyChan():
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the waiting ns2 notification to eventually become ready")
+	}
+
+	if _, _, ok := q.dequeue(); !ok {
+		t.Fatal("expected the ns2 notification to have been enqueued once room opened up")
+	}
+}
+
+func TestWatcherQueueWaitIfChannelFullDisconnectsAfterTimeout(t *testing.T) {
+	q := newWatcherQueue(1, WaitIfChannelFull)
+	q.waitTimeout = 10 * time.Millisecond
+
+	q.notify("ns1", watch.Event{Type: watch.Added}, func() { t.Fatal("unexpected disconnect") })
+
+	disconnected := make(chan struct{})
+	q.notify("ns2", watch.Event{Type: watch.Added}, func() { close(disconnected) })
+
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("expected onDisconnect once waitTimeout elapsed with no room freed")
+	}
+}
+
+func TestWatcherQueueWaitIfChannelFullPreservesCallOrderAcrossWaiters(t *testing.T) {
+	q := newWatcherQueue(1, WaitIfChannelFull)
+	q.waitTimeout = time.Second
+
+	q.notify("ns1", watch.Event{Type: watch.Added}, func() { t.Fatal("unexpected disconnect") })
+	// Both of these overflow while ns1 occupies the only slot, and are for different namespaces,
+	// so neither can coalesce with the other; only call order should decide which gets the slot
+	// that frees up first.
+	q.notify("ns2", watch.Event{Type: watch.Modified}, func() { t.Fatal("unexpected disconnect for ns2") })
+	q.notify("ns3", watch.Event{Type: watch.Deleted}, func() { t.Fatal("unexpected disconnect for ns3") })
+
+	// Drain ns1 twice, once per waiter taking the freed slot, and confirm ns2's notification
+	// (queued first) comes out before ns3's.
+	if _, _, ok := q.dequeue(); !ok {
+		t.Fatal("expected to dequeue ns1's notification")
+	}
+	select {
+	case <-q.readyChan():
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the first waiting notification to become ready")
+	}
+	event, _, ok := q.dequeue()
+	if !ok || event.Type != watch.Modified {
+		t.Fatalf("expected ns2's notification (queued first) to win the freed slot, got %+v ok=%v", event, ok)
+	}
+
+	select {
+	case <-q.readyChan():
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the second waiting notification to become ready")
+	}
+	event, _, ok = q.dequeue()
+	if !ok || event.Type != watch.Deleted {
+		t.Fatalf("expected ns3's notification last, got %+v ok=%v", event, ok)
+	}
+}
+
+func TestWatcherQueueNotifyNeverBlocksCaller(t *testing.T) {
+	q := newWatcherQueue(1, WaitIfChannelFull)
+	q.waitTimeout = time.Hour
+
+	q.notify("ns1", watch.Event{Type: watch.Added}, func() { t.Fatal("unexpected disconnect") })
+
+	done := make(chan struct{})
+	go func() {
+		q.notify("ns2", watch.Event{Type: watch.Added}, func() {})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("notify blocked the caller instead of handing the wait off to its own goroutine")
+	}
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/watch"
+
+	projectapi "github.com/openshift/origin/pkg/project/api"
+)
+
+// ConditionFunc returns true once event satisfies whatever an Until caller is waiting for,
+// mirroring k8s.io/apimachinery/pkg/watch/until.go.
+type ConditionFunc func(event watch.Event) (bool, error)
+
+// ErrWatchClosed is returned by Until if the watch's result channel closes before every
+// condition is satisfied.
+var ErrWatchClosed = errors.New("project watch closed before conditions were met")
+
+// Until reads from w, advancing through conditions in order, until the final condition is
+// satisfied, ctx is done, or the watch closes. It does not replay past events: each condition
+// must hold for some event the watcher delivers after Until starts watching for it. Callers
+// like `oc new-project --wait` and integration tests can use it in place of hand-rolled channel
+// loops over a *userProjectWatcher's ResultChan.
+func Until(ctx context.Context, w watch.Interface, conditions ...ConditionFunc) (*watch.Event, error) {
+	ch := w.ResultChan()
+	defer w.Stop()
+
+	var lastEvent *watch.Event
+	for _, condition := range conditions {
+	waitForCondition:
+		for {
+			select {
+			case event, ok := <-ch:
+				if !ok {
+					return lastEvent, ErrWatchClosed
+				}
+				lastEvent = &event
+
+				done, err := condition(event)
+				if err != nil {
+					return lastEvent, err
+				}
+				if done {
+					break waitForCondition
+				}
+
+			case <-ctx.Done():
+				return lastEvent, ctx.Err()
+			}
+		}
+	}
+	return lastEvent, nil
+}
+
+// ProjectActive is satisfied the first time project name is observed with status phase Active,
+// for callers like `oc new-project --wait` that need to block until a newly created project is
+// usable.
+func ProjectActive(name string) ConditionFunc {
+	return func(event watch.Event) (bool, error) {
+		if err := errorFromEvent(event); err != nil {
+			return false, err
+		}
+		project, ok := event.Object.(*projectapi.Project)
+		if !ok || project.Name != name {
+			return false, nil
+		}
+		return event.Type != watch.Deleted && project.Status.Phase == kapi.NamespaceActive, nil
+	}
+}
+
+// ProjectDeleted is satisfied the first time project name is observed to have been deleted.
+func ProjectDeleted(name string) ConditionFunc {
+	return func(event watch.Event) (bool, error) {
+		if err := errorFromEvent(event); err != nil {
+			return false, err
+		}
+		project, ok := event.Object.(*projectapi.Project)
+		if !ok || project.Name != name {
+			return false, nil
+		}
+		return event.Type == watch.Deleted, nil
+	}
+}
+
+// ProjectAccessGranted is satisfied the first time project name appears on the watch at all,
+// i.e. the point at which the watching user has gained visibility into it.
+func ProjectAccessGranted(name string) ConditionFunc {
+	return func(event watch.Event) (bool, error) {
+		if err := errorFromEvent(event); err != nil {
+			return false, err
+		}
+		project, ok := event.Object.(*projectapi.Project)
+		if !ok || project.Name != name {
+			return false, nil
+		}
+		return event.Type == watch.Added || event.Type == watch.Modified, nil
+	}
+}
+
+// errorFromEvent turns a watch.Error event (e.g. the Gone event NewUserProjectWatcher sends for
+// a too-old resourceVersion) into a Go error for ConditionFunc implementations to surface.
+func errorFromEvent(event watch.Event) error {
+	if event.Type != watch.Error {
+		return nil
+	}
+	if status, ok := event.Object.(*unversioned.Status); ok {
+		return errors.New(status.Message)
+	}
+	return errors.New("project watch reported an error")
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/watch"
+
+	projectapi "github.com/openshift/origin/pkg/project/api"
+)
+
+func projectWithPhase(name string, phase kapi.NamespacePhase) *projectapi.Project {
+	return &projectapi.Project{
+		ObjectMeta: kapi.ObjectMeta{Name: name},
+		Status:     kapi.NamespaceStatus{Phase: phase},
+	}
+}
+
+func TestUntilReturnsOnceConditionSatisfied(t *testing.T) {
+	fake := watch.NewFake()
+	go func() {
+		fake.Add(projectWithPhase("proj1", kapi.NamespacePending))
+		fake.Modify(projectWithPhase("proj1", kapi.NamespaceActive))
+	}()
+
+	event, err := Until(context.Background(), fake, ProjectActive("proj1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	project := event.Object.(*projectapi.Project)
+	if project.Status.Phase != kapi.NamespaceActive {
+		t.Errorf("expected the returned event to be the Active one, got phase %v", project.Status.Phase)
+	}
+}
+
+func TestUntilIgnoresOtherProjects(t *testing.T) {
+	fake := watch.NewFake()
+	go func() {
+		fake.Add(projectWithPhase("other", kapi.NamespaceActive))
+		fake.Add(projectWithPhase("proj1", kapi.NamespaceActive))
+	}()
+
+	event, err := Until(context.Background(), fake, ProjectActive("proj1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.Object.(*projectapi.Project).Name != "proj1" {
+		t.Errorf("expected to wait past the unrelated project, got %q", event.Object.(*projectapi.Project).Name)
+	}
+}
+
+func TestUntilChainsMultipleConditions(t *testing.T) {
+	fake := watch.NewFake()
+	go func() {
+		fake.Add(projectWithPhase("proj1", kapi.NamespaceActive))
+		fake.Delete(projectWithPhase("proj1", kapi.NamespaceActive))
+	}()
+
+	_, err := Until(context.Background(), fake, ProjectAccessGranted("proj1"), ProjectDeleted("proj1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestUntilReturnsErrWatchClosed(t *testing.T) {
+	fake := watch.NewFake()
+	go fake.Stop()
+
+	_, err := Until(context.Background(), fake, ProjectActive("proj1"))
+	if err != ErrWatchClosed {
+		t.Errorf("expected ErrWatchClosed, got %v", err)
+	}
+}
+
+func TestUntilRespectsContextCancellation(t *testing.T) {
+	fake := watch.NewFake()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Until(ctx, fake, ProjectActive("proj1"))
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestUntilSurfacesErrorEvents(t *testing.T) {
+	fake := watch.NewFake()
+	go fake.Error(&unversioned.Status{Message: "too old resource version: 5"})
+
+	_, err := Until(context.Background(), fake, ProjectActive("proj1"))
+	if err == nil || err.Error() != "too old resource version: 5" {
+		t.Errorf("expected the watch.Error's message to be surfaced, got %v", err)
+	}
+}
+
+func TestProjectDeletedIgnoresNonDeleteEvents(t *testing.T) {
+	condition := ProjectDeleted("proj1")
+
+	done, err := condition(watch.Event{Type: watch.Added, Object: projectWithPhase("proj1", kapi.NamespaceActive)})
+	if err != nil || done {
+		t.Errorf("expected Added to not satisfy ProjectDeleted, got done=%v err=%v", done, err)
+	}
+
+	done, err = condition(watch.Event{Type: watch.Deleted, Object: projectWithPhase("proj1", kapi.NamespaceActive)})
+	if err != nil || !done {
+		t.Errorf("expected Deleted to satisfy ProjectDeleted, got done=%v err=%v", done, err)
+	}
+}
+
+func TestErrorFromEventNilForNonErrorEvents(t *testing.T) {
+	if err := errorFromEvent(watch.Event{Type: watch.Added}); err != nil {
+		t.Errorf("expected nil error for a non-Error event, got %v", err)
+	}
+}
+
+func TestUntilRespectsShortContextDeadline(t *testing.T) {
+	fake := watch.NewFake()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := Until(ctx, fake, ProjectActive("proj1"))
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Until took %v to respect a 10ms deadline", elapsed)
+	}
+}
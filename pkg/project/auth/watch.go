@@ -2,7 +2,10 @@ package auth
 
 import (
 	"errors"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 
@@ -14,6 +17,7 @@ import (
 	"k8s.io/kubernetes/pkg/util/sets"
 	"k8s.io/kubernetes/pkg/watch"
 
+	projectapi "github.com/openshift/origin/pkg/project/api"
 	projectcache "github.com/openshift/origin/pkg/project/cache"
 	projectutil "github.com/openshift/origin/pkg/project/util"
 )
@@ -27,6 +31,10 @@ type CacheWatcher interface {
 type WatchableCache interface {
 	// RemoveWatcher removes a watcher
 	RemoveWatcher(CacheWatcher)
+	// AddWatcher registers a watcher to be notified of group membership changes relevant to
+	// userInfo. Used by userWatchHub to register a single upstream CacheWatcher on behalf of
+	// every broadcasterWatcher subscribed for the same user.
+	AddWatcher(userInfo user.Info, watcher CacheWatcher)
 	// List returns the set of namespace names the user has access to view
 	List(userInfo user.Info) (*kapi.NamespaceList, error)
 }
@@ -36,11 +44,15 @@ type userProjectWatcher struct {
 	username string
 	groups   []string
 
-	// cacheIncoming is a buffered channel used for notification to watcher.  If the buffer fills up,
-	// then the watcher will be removed and the connection will be broken.
-	cacheIncoming chan watch.Event
-	// cacheError is a cached channel that is put to serially.  In theory, only one item will
-	// ever be placed on it.
+	// queue holds notifications not yet delivered to Watch(), coalescing or dropping them
+	// per fullChannelBehavior once full.
+	queue *watcherQueue
+
+	// cacheError carries the error that tore this watch down, for Watch() to report on
+	// ResultChan before closing it. It's sized 1 because only the first send matters: disconnect
+	// makes that send non-blocking so that a second, concurrent overflow timeout under
+	// WaitIfChannelFull (queue.go's waitAndEnqueue can run more than one of these at once) can't
+	// block forever with nothing left to read it.
 	cacheError chan error
 
 	// outgoing is the unbuffered `ResultChan` use for the watch.  Backups of this channel will block
@@ -59,7 +71,30 @@ type userProjectWatcher struct {
 	authCache    WatchableCache
 
 	initialProjects []kapi.Namespace
-	knownProjects   sets.String
+	// knownProjects tracks the last ResourceVersion we notified this watcher about for
+	// each namespace it can see, keyed by namespace name.  It lets GroupMembershipChanged
+	// distinguish an Added from a Modified and suppress a Modified that would just
+	// re-announce a ResourceVersion the watcher already has.
+	knownProjects map[string]string
+
+	// initialEvent is queued ahead of everything else in Watch() when the requested
+	// resourceVersion can no longer be resumed from, mirroring etcd's "compacted
+	// revision" behavior.
+	initialEvent *watch.Event
+
+	// filter narrows the watch to projects matching a label/field selector built by the REST
+	// layer from the request's ListOptions. A nil filter matches everything.
+	filter func(*projectapi.Project) bool
+
+	// bookmarkInterval controls how often Watch() emits a watch.Bookmark when nothing else has
+	// been sent, so idle watches can advance their ResourceVersion without a relist.
+	bookmarkInterval time.Duration
+
+	// rvLock guards latestSeenRV.
+	rvLock sync.Mutex
+	// latestSeenRV is the highest ResourceVersion observed across every namespace notification
+	// delivered to this watcher, used as the payload for Bookmark events.
+	latestSeenRV string
 }
 
 var (
@@ -68,33 +103,65 @@ var (
 	watchChannelHWM etcd.HighWaterMark
 )
 
-func NewUserProjectWatcher(username string, groups []string, projectCache *projectcache.ProjectCache, authCache WatchableCache, includeAllExistingProjects bool) *userProjectWatcher {
+// defaultBookmarkInterval is how often Watch() emits a watch.Bookmark when a watcher has
+// otherwise been idle, matching etcd's default progress notify interval.
+const defaultBookmarkInterval = 60 * time.Second
+
+// NewUserProjectWatcher creates a new userProjectWatcher. If resourceVersion is non-empty, the
+// watcher attempts to resume from that point the way a raw etcd Watch(rev) would: the caller's
+// current visible project list is emitted as Added events, and if resourceVersion is older than
+// what can be reconstructed from the project cache's knowledge of the watcher's projects, the
+// first event delivered on the watch is a watch.Error with Status.Reason Gone so that the caller
+// (typically a client-go reflector) knows to relist instead of assuming it is caught up.
+//
+// queueSize and fullChannelBehavior let the caller (ultimately the master config) tune how the
+// watcher copes with a burst of auth cache notifications larger than it can keep up with; a
+// queueSize of 0 falls back to defaultWatcherQueueSize.
+//
+// filter, when non-nil, restricts the watch to projects matching a label/field selector; it is
+// applied to the initial snapshot below and by GroupMembershipChanged for every later change.
+//
+// bookmarkInterval controls how often Watch() emits a watch.Bookmark carrying the latest
+// ResourceVersion this watcher has observed when nothing else was sent in that interval, letting
+// an idle watch survive a load balancer idle timeout and client-go reflectors advance without a
+// relist. A bookmarkInterval of 0 falls back to defaultBookmarkInterval.
+func NewUserProjectWatcher(username string, groups []string, projectCache *projectcache.ProjectCache, authCache WatchableCache, includeAllExistingProjects bool, resourceVersion string, queueSize int, fullChannelBehavior FullChannelBehavior, filter func(*projectapi.Project) bool, bookmarkInterval time.Duration) *userProjectWatcher {
 	userInfo := &user.DefaultInfo{Name: username, Groups: groups}
 	namespaces, _ := authCache.List(userInfo)
-	knownProjects := sets.String{}
+	knownProjects := map[string]string{}
+	// this is optional.  If they don't request it, don't include it.
+	initialProjects := []kapi.Namespace{}
 	for _, namespace := range namespaces.Items {
-		knownProjects.Insert(namespace.Name)
+		if filter != nil && !filter(projectutil.ConvertNamespace(&namespace)) {
+			continue
+		}
+		knownProjects[namespace.Name] = namespace.ResourceVersion
+		if includeAllExistingProjects || len(resourceVersion) > 0 {
+			initialProjects = append(initialProjects, namespace)
+		}
 	}
 
-	// this is optional.  If they don't request it, don't include it.
-	initialProjects := []kapi.Namespace{}
-	if includeAllExistingProjects {
-		initialProjects = append(initialProjects, namespaces.Items...)
+	if bookmarkInterval <= 0 {
+		bookmarkInterval = defaultBookmarkInterval
 	}
 
 	w := &userProjectWatcher{
 		username: username,
 		groups:   groups,
 
-		cacheIncoming: make(chan watch.Event, 1000),
-		cacheError:    make(chan error, 1),
-		outgoing:      make(chan watch.Event),
-		userStop:      make(chan struct{}),
+		queue: newWatcherQueue(queueSize, fullChannelBehavior),
 
-		projectCache:    projectCache,
-		authCache:       authCache,
-		initialProjects: initialProjects,
-		knownProjects:   knownProjects,
+		cacheError: make(chan error, 1),
+		outgoing:   make(chan watch.Event),
+		userStop:   make(chan struct{}),
+
+		projectCache:     projectCache,
+		authCache:        authCache,
+		initialProjects:  initialProjects,
+		knownProjects:    knownProjects,
+		filter:           filter,
+		bookmarkInterval: bookmarkInterval,
+		latestSeenRV:     newestResourceVersion(knownProjects),
 	}
 	w.emit = func(e watch.Event) {
 		select {
@@ -102,30 +169,109 @@ func NewUserProjectWatcher(username string, groups []string, projectCache *proje
 		case <-w.userStop:
 		}
 	}
+
+	if len(resourceVersion) > 0 {
+		if oldest := oldestResourceVersion(knownProjects); len(oldest) > 0 && compareResourceVersions(resourceVersion, oldest) < 0 {
+			// We can't prove that every change since resourceVersion was observed, so tell the
+			// caller to relist rather than risk silently skipping events.
+			event := makeGoneEvent(resourceVersion)
+			w.initialEvent = &event
+		}
+	}
+
 	return w
 }
 
+// oldestResourceVersion returns the smallest ResourceVersion among known, or "" if known is empty.
+func oldestResourceVersion(known map[string]string) string {
+	oldest := ""
+	for _, resourceVersion := range known {
+		if len(oldest) == 0 || compareResourceVersions(resourceVersion, oldest) < 0 {
+			oldest = resourceVersion
+		}
+	}
+	return oldest
+}
+
+// newestResourceVersion returns the largest ResourceVersion among known, or "" if known is empty.
+func newestResourceVersion(known map[string]string) string {
+	newest := ""
+	for _, resourceVersion := range known {
+		if len(newest) == 0 || compareResourceVersions(resourceVersion, newest) > 0 {
+			newest = resourceVersion
+		}
+	}
+	return newest
+}
+
+// compareResourceVersions compares two etcd-style numeric ResourceVersions, falling back to a
+// lexical comparison if either fails to parse.
+func compareResourceVersions(a, b string) int {
+	aVal, aErr := strconv.ParseUint(a, 10, 64)
+	bVal, bErr := strconv.ParseUint(b, 10, 64)
+	if aErr != nil || bErr != nil {
+		return strings.Compare(a, b)
+	}
+	switch {
+	case aVal < bVal:
+		return -1
+	case aVal > bVal:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// observeResourceVersion records rv as seen if it's newer than anything seen before, for use as
+// the payload of the next watch.Bookmark event.
+func (w *userProjectWatcher) observeResourceVersion(rv string) {
+	if len(rv) == 0 {
+		return
+	}
+	w.rvLock.Lock()
+	defer w.rvLock.Unlock()
+	if len(w.latestSeenRV) == 0 || compareResourceVersions(rv, w.latestSeenRV) > 0 {
+		w.latestSeenRV = rv
+	}
+}
+
+// currentLatestResourceVersion returns the highest ResourceVersion observed so far.
+func (w *userProjectWatcher) currentLatestResourceVersion() string {
+	w.rvLock.Lock()
+	defer w.rvLock.Unlock()
+	return w.latestSeenRV
+}
+
+// disconnect is passed to queue.notify as the callback to invoke once a notification can't be
+// delivered and the watch must be torn down. WaitIfChannelFull can run more than one of these
+// concurrently for the same watcher (queue.go's waitAndEnqueue hands off to the next waiter
+// before calling onDisconnect), so the send to cacheError must not block once the first one has
+// already filled it.
+func (w *userProjectWatcher) disconnect(timeoutMessage string) func() {
+	return func() {
+		w.authCache.RemoveWatcher(w)
+		select {
+		case w.cacheError <- errors.New(timeoutMessage):
+		default:
+		}
+	}
+}
+
 func (w *userProjectWatcher) GroupMembershipChanged(namespaceName string, latestUsers, lastestGroups, removedUsers, removedGroups, addedUsers, addedGroups sets.String) {
 	hasAccess := latestUsers.Has(w.username) || lastestGroups.HasAny(w.groups...)
 	removed := !hasAccess && (removedUsers.Has(w.username) || removedGroups.HasAny(w.groups...))
 
 	switch {
 	case removed:
-		if !w.knownProjects.Has(namespaceName) {
+		if _, known := w.knownProjects[namespaceName]; !known {
 			return
 		}
-		w.knownProjects.Delete(namespaceName)
+		delete(w.knownProjects, namespaceName)
 
-		select {
-		case w.cacheIncoming <- watch.Event{
+		w.queue.notify(namespaceName, watch.Event{
 			Type:   watch.Deleted,
 			Object: projectutil.ConvertNamespace(&kapi.Namespace{ObjectMeta: kapi.ObjectMeta{Name: namespaceName}}),
-		}:
-		default:
-			// remove the watcher so that we wont' be notified again and block
-			w.authCache.RemoveWatcher(w)
-			w.cacheError <- errors.New("delete notification timeout")
-		}
+		}, w.disconnect("delete notification timeout"))
 
 	case hasAccess:
 		namespace, err := w.projectCache.GetNamespace(namespaceName)
@@ -133,24 +279,40 @@ func (w *userProjectWatcher) GroupMembershipChanged(namespaceName string, latest
 			utilruntime.HandleError(err)
 			return
 		}
+		project := projectutil.ConvertNamespace(namespace)
+		w.observeResourceVersion(namespace.ResourceVersion)
+
+		if w.filter != nil && !w.filter(project) {
+			// the project no longer matches the watcher's selector; if the watcher previously
+			// saw it, tell the client it disappeared the same way a real Delete would.
+			if _, known := w.knownProjects[namespaceName]; known {
+				delete(w.knownProjects, namespaceName)
+				w.queue.notify(namespaceName, watch.Event{
+					Type:   watch.Deleted,
+					Object: project,
+				}, w.disconnect("delete notification timeout"))
+			}
+			return
+		}
+
+		// if we already have this in our list at the same ResourceVersion, we were notified
+		// about a change that doesn't affect what we've already told this watcher.
+		if lastKnownResourceVersion, known := w.knownProjects[namespaceName]; known && lastKnownResourceVersion == namespace.ResourceVersion {
+			return
+		}
+
 		event := watch.Event{
 			Type:   watch.Added,
-			Object: projectutil.ConvertNamespace(namespace),
+			Object: project,
 		}
 
 		// if we already have this in our list, then we're getting notified because the object changed
-		if w.knownProjects.Has(namespaceName) {
+		if _, known := w.knownProjects[namespaceName]; known {
 			event.Type = watch.Modified
 		}
-		w.knownProjects.Insert(namespace.Name)
+		w.knownProjects[namespace.Name] = namespace.ResourceVersion
 
-		select {
-		case w.cacheIncoming <- event:
-		default:
-			// remove the watcher so that we won't be notified again and block
-			w.authCache.RemoveWatcher(w)
-			w.cacheError <- errors.New("add notification timeout")
-		}
+		w.queue.notify(namespaceName, event, w.disconnect("add notification timeout"))
 
 	}
 
@@ -166,6 +328,11 @@ func (w *userProjectWatcher) Watch() {
 	}()
 	defer utilruntime.HandleCrash()
 
+	if w.initialEvent != nil {
+		w.emit(*w.initialEvent)
+		return
+	}
+
 	// start by emitting all the `initialProjects`
 	for i := range w.initialProjects {
 		// keep this check here to sure we don't keep this open in the case of failures
@@ -182,6 +349,10 @@ func (w *userProjectWatcher) Watch() {
 		})
 	}
 
+	bookmarkTicker := time.NewTicker(w.bookmarkInterval)
+	defer bookmarkTicker.Stop()
+	sentSinceLastBookmark := false
+
 	for {
 		select {
 		case err := <-w.cacheError:
@@ -191,13 +362,31 @@ func (w *userProjectWatcher) Watch() {
 		case <-w.userStop:
 			return
 
-		case event := <-w.cacheIncoming:
-			if curLen := int64(len(w.cacheIncoming)); watchChannelHWM.Update(curLen) {
-				// Monitor if this gets backed up, and how much.
-				glog.V(2).Infof("watch: %v objects queued in project cache watching channel.", curLen)
+		case <-bookmarkTicker.C:
+			if !sentSinceLastBookmark {
+				if rv := w.currentLatestResourceVersion(); len(rv) > 0 {
+					w.emit(watch.Event{
+						Type:   watch.Bookmark,
+						Object: &projectapi.Project{ObjectMeta: kapi.ObjectMeta{ResourceVersion: rv}},
+					})
+				}
+			}
+			sentSinceLastBookmark = false
+
+		case <-w.queue.readyChan():
+			for {
+				event, depth, ok := w.queue.dequeue()
+				if !ok {
+					break
+				}
+				if watchChannelHWM.Update(int64(depth)) {
+					// Monitor if this gets backed up, and how much.
+					glog.V(2).Infof("watch: %v objects queued in project cache watching channel.", depth)
+				}
+
+				w.emit(event)
+				sentSinceLastBookmark = true
 			}
-
-			w.emit(event)
 		}
 	}
 }
@@ -212,6 +401,20 @@ func makeErrorEvent(err error) watch.Event {
 	}
 }
 
+// makeGoneEvent builds the watch.Error event returned when a caller's requested resourceVersion
+// can no longer be resumed from, the analogue of etcd returning a compacted revision error.
+func makeGoneEvent(resourceVersion string) watch.Event {
+	return watch.Event{
+		Type: watch.Error,
+		Object: &unversioned.Status{
+			Status:  unversioned.StatusFailure,
+			Message: "too old resource version: " + resourceVersion,
+			Reason:  unversioned.StatusReason("Gone"),
+			Code:    410,
+		},
+	}
+}
+
 // ResultChan implements watch.Interface.
 func (w *userProjectWatcher) ResultChan() <-chan watch.Event {
 	return w.outgoing
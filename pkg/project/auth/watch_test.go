@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompareResourceVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1", "2", -1},
+		{"2", "1", 1},
+		{"5", "5", 0},
+		{"10", "9", 1}, // numeric, not lexical, comparison
+		{"abc", "abd", -1},
+	}
+	for _, test := range tests {
+		if got := compareResourceVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareResourceVersions(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestOldestAndNewestResourceVersion(t *testing.T) {
+	known := map[string]string{
+		"ns1": "5",
+		"ns2": "1",
+		"ns3": "9",
+	}
+	if oldest := oldestResourceVersion(known); oldest != "1" {
+		t.Errorf("oldestResourceVersion() = %q, want %q", oldest, "1")
+	}
+	if newest := newestResourceVersion(known); newest != "9" {
+		t.Errorf("newestResourceVersion() = %q, want %q", newest, "9")
+	}
+}
+
+func TestOldestAndNewestResourceVersionEmpty(t *testing.T) {
+	known := map[string]string{}
+	if oldest := oldestResourceVersion(known); oldest != "" {
+		t.Errorf("oldestResourceVersion() on empty map = %q, want empty", oldest)
+	}
+	if newest := newestResourceVersion(known); newest != "" {
+		t.Errorf("newestResourceVersion() on empty map = %q, want empty", newest)
+	}
+}
+
+func TestObserveResourceVersionOnlyAdvances(t *testing.T) {
+	w := &userProjectWatcher{}
+
+	w.observeResourceVersion("5")
+	w.observeResourceVersion("3")
+	if got := w.currentLatestResourceVersion(); got != "5" {
+		t.Errorf("currentLatestResourceVersion() = %q, want %q after an older observation", got, "5")
+	}
+
+	w.observeResourceVersion("10")
+	if got := w.currentLatestResourceVersion(); got != "10" {
+		t.Errorf("currentLatestResourceVersion() = %q, want %q after a newer observation", got, "10")
+	}
+
+	w.observeResourceVersion("")
+	if got := w.currentLatestResourceVersion(); got != "10" {
+		t.Errorf("currentLatestResourceVersion() = %q, want unchanged %q after an empty observation", got, "10")
+	}
+}
+
+// TestUserProjectWatcherDisconnectConcurrentCallsDontBlock mirrors
+// TestHubRegistryReleaseIsIdempotentUnderConcurrentCallers in hub_test.go: WaitIfChannelFull can
+// time out more than one queued notification for the same watcher at once (queue.go's
+// waitAndEnqueue hands off to the next waiter before calling onDisconnect), so disconnect must
+// tolerate being invoked concurrently without deadlocking on an already-full cacheError.
+func TestUserProjectWatcherDisconnectConcurrentCallsDontBlock(t *testing.T) {
+	w := &userProjectWatcher{
+		authCache:  &fakeWatchableCache{},
+		cacheError: make(chan error, 1),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				w.disconnect(fmt.Sprintf("timeout %d", i))()
+			}(i)
+		}
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("disconnect blocked forever under concurrent callers once cacheError was full")
+	}
+
+	select {
+	case <-w.cacheError:
+	default:
+		t.Fatal("expected cacheError to have captured the first disconnect's error")
+	}
+}